@@ -18,11 +18,14 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"os"
+	"sync"
 	"syscall"
 	"text/tabwriter"
 	"time"
 
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/host"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
@@ -35,10 +38,15 @@ import (
 )
 
 // Proc includes task-related functions.
-//
-// At the moment, this is limited to exec support.
 type Proc struct {
 	Kernel *kernel.Kernel
+
+	// mu protects execs.
+	mu sync.Mutex
+
+	// execs tracks processes started by ExecAsync, keyed by PID, so that
+	// ResizeTTY, SendSignal and WaitExec can find them again.
+	execs map[kernel.ThreadID]*execProcess
 }
 
 // ExecArgs is the set of arguments to exec.
@@ -69,20 +77,220 @@ type ExecArgs struct {
 	// belongs.
 	ExtraKGIDs []auth.KGID
 
-	// Capabilities is the list of capabilities to give to the process.
+	// Capabilities is the list of capabilities to give to the process,
+	// including any ambient set. The ambient set is what lets a
+	// non-root KUID keep the capabilities an OCI spec granted it instead
+	// of losing them the moment the new task's effective UID changes.
 	Capabilities *auth.TaskCapabilities
 
+	// TTY indicates that a pty should be allocated for the new process.
+	// The master end is returned via ExecAsyncReply.FilePayload so that
+	// runsc can proxy it to the user's terminal; the replica end becomes
+	// the new process's stdin/stdout/stderr in place of FilePayload.Files.
+	TTY bool `json:"tty"`
+
+	// Detach marks a process started by ExecAsync as one nobody will wait
+	// for: WaitExec refuses it, and its entry is dropped as soon as it
+	// exits. ExecAsync returns once the process is created either way.
+	Detach bool `json:"detach"`
+
 	// FilePayload determines the files to give to the new process.
 	urpc.FilePayload
 }
 
-// Exec runs a new task.
+// Exec runs a new task and blocks until it exits.
 func (proc *Proc) Exec(args *ExecArgs, waitStatus *uint32) error {
+	newTG, _, err := proc.createProcess(args)
+	if err != nil {
+		return err
+	}
+
+	// Wait for completion.
+	newTG.WaitExited()
+	*waitStatus = newTG.ExitStatus().Status()
+	return nil
+}
+
+// execProcess tracks a process started by ExecAsync, so that ResizeTTY,
+// SendSignal and WaitExec can reach it again by PID after ExecAsync has
+// returned.
+type execProcess struct {
+	tg  *kernel.ThreadGroup
+	tty *host.TTYFileOperations // nil unless the caller set ExecArgs.TTY
+
+	// detached records whether the process was started with
+	// ExecArgs.Detach. WaitExec refuses to wait on a detached process,
+	// since nothing else about it is tracked for the caller to retrieve
+	// once it exits.
+	detached bool
+
+	// done is closed once the process has exited.
+	done   chan struct{}
+	status uint32
+}
+
+// ExecAsyncReply is returned by ExecAsync.
+type ExecAsyncReply struct {
+	// PID identifies the new process for ResizeTTY, SendSignal and
+	// WaitExec.
+	PID kernel.ThreadID
+
+	// FilePayload carries back the pty master FD when ExecArgs.TTY was
+	// set; it is empty otherwise.
+	urpc.FilePayload
+}
+
+// ExecAsync starts a new task without waiting for it to exit. It is the
+// basis for "runsc exec -it" (TTY streaming and signal forwarding) and
+// "runsc exec -d" (Detach), neither of which can be built on top of the
+// blocking Exec RPC.
+func (proc *Proc) ExecAsync(args *ExecArgs, reply *ExecAsyncReply) error {
+	newTG, tty, err := proc.createProcess(args)
+	if err != nil {
+		return err
+	}
+	pid := proc.Kernel.TaskSet().Root.IDOfThreadGroup(newTG)
+
+	ep := &execProcess{tg: newTG, tty: tty, detached: args.Detach, done: make(chan struct{})}
+	proc.mu.Lock()
+	if proc.execs == nil {
+		proc.execs = make(map[kernel.ThreadID]*execProcess)
+	}
+	proc.execs[pid] = ep
+	proc.mu.Unlock()
+
+	// Always wait in the background, detached or not, so the process's
+	// exit status is captured as soon as it's available. The entry
+	// itself is only reclaimed here for a detached process, since
+	// nothing else will ever consume it; WaitExec reclaims it for every
+	// other process once it has delivered the status to its caller. A
+	// long-lived sandbox doing repeated execs would otherwise leak one
+	// execProcess (and its ThreadGroup and TTY master) per call forever.
+	go func() {
+		newTG.WaitExited()
+		ep.status = newTG.ExitStatus().Status()
+		close(ep.done)
+
+		if ep.detached {
+			proc.mu.Lock()
+			delete(proc.execs, pid)
+			proc.mu.Unlock()
+		}
+	}()
+
+	reply.PID = pid
+	if tty != nil {
+		reply.FilePayload.Files = []*os.File{tty.MasterFile()}
+	}
+	return nil
+}
+
+// lookupExec returns the execProcess registered for pid by a prior
+// ExecAsync call.
+func (proc *Proc) lookupExec(pid kernel.ThreadID) (*execProcess, error) {
+	proc.mu.Lock()
+	defer proc.mu.Unlock()
+	ep, ok := proc.execs[pid]
+	if !ok {
+		return nil, fmt.Errorf("no exec'd process with PID %d", pid)
+	}
+	return ep, nil
+}
+
+// ResizeTTYArgs is the set of arguments to ResizeTTY.
+type ResizeTTYArgs struct {
+	// PID is the PID returned by a prior ExecAsync call.
+	PID kernel.ThreadID
+
+	// Rows and Cols are the new terminal dimensions.
+	Rows uint16
+	Cols uint16
+}
+
+// ResizeTTY changes the window size of the pty allocated for a process
+// started via ExecAsync with TTY set, mirroring a SIGWINCH-triggering
+// ioctl(TIOCSWINSZ) on a real terminal.
+func (proc *Proc) ResizeTTY(args *ResizeTTYArgs, _ *struct{}) error {
+	ep, err := proc.lookupExec(args.PID)
+	if err != nil {
+		return err
+	}
+	if ep.tty == nil {
+		return fmt.Errorf("process %d was not started with a TTY", args.PID)
+	}
+	return ep.tty.SetWinSize(args.Rows, args.Cols)
+}
+
+// SendSignalArgs is the set of arguments to SendSignal.
+type SendSignalArgs struct {
+	// PID is the PID returned by a prior ExecAsync call.
+	PID kernel.ThreadID
+
+	// Signo is the signal to deliver, e.g. one forwarded from the user's
+	// terminal (SIGINT) or window (SIGWINCH).
+	Signo int32
+}
+
+// SendSignal delivers a signal to a process started via ExecAsync,
+// forwarding signals runsc receives on behalf of an attached "exec -it"
+// session (SIGINT, SIGWINCH, ...) into the sandbox.
+func (proc *Proc) SendSignal(args *SendSignalArgs, _ *struct{}) error {
+	ep, err := proc.lookupExec(args.PID)
+	if err != nil {
+		return err
+	}
+	return proc.Kernel.SendExternalSignalThreadGroup(ep.tg, &arch.SignalInfo{Signo: args.Signo})
+}
+
+// WaitExecArgs is the set of arguments to WaitExec.
+type WaitExecArgs struct {
+	// PID is the PID returned by a prior ExecAsync call.
+	PID kernel.ThreadID
+}
+
+// WaitExec blocks until the process started by the corresponding
+// ExecAsync call exits, then returns its wait status. It is an error to
+// call WaitExec for a process started with Detach.
+//
+// WaitExec reclaims the process's entry in proc.execs once it has
+// delivered the status, since the caller has now collected the one
+// thing the entry exists to hand back and WaitExec cannot usefully be
+// called twice. This must happen here, not in ExecAsync's exit
+// goroutine: that goroutine runs concurrently with (and often finishes
+// before) the caller's WaitExec, so reaping there instead would almost
+// always make lookupExec fail to find an entry that hasn't been waited
+// on yet, losing the exit status WaitExec exists to return.
+func (proc *Proc) WaitExec(args *WaitExecArgs, waitStatus *uint32) error {
+	ep, err := proc.lookupExec(args.PID)
+	if err != nil {
+		return err
+	}
+	if ep.detached {
+		return fmt.Errorf("process %d was started with Detach; its status cannot be waited for", args.PID)
+	}
+	<-ep.done
+	*waitStatus = ep.status
+
+	proc.mu.Lock()
+	delete(proc.execs, args.PID)
+	proc.mu.Unlock()
+	return nil
+}
+
+// createProcess builds the credentials and FD table described by args,
+// allocates a pty if args.TTY is set, and starts the new task. It is
+// shared by Exec and ExecAsync, which differ only in whether they block
+// for the result.
+func (proc *Proc) createProcess(args *ExecArgs) (*kernel.ThreadGroup, *host.TTYFileOperations, error) {
 	// Import file descriptors.
 	l := limits.NewLimitSet()
 	fdm := proc.Kernel.NewFDMap()
 	defer fdm.DecRef()
 
+	// NewUserCredentials carries args.Capabilities.AmbientCaps through to
+	// the new task's credentials, so a non-root KUID exec'd here keeps the
+	// capabilities the OCI spec granted it rather than losing them the
+	// moment its effective UID stops being 0.
 	creds := auth.NewUserCredentials(
 		args.KUID,
 		args.KGID,
@@ -106,11 +314,26 @@ func (proc *Proc) Exec(args *ExecArgs, waitStatus *uint32) error {
 	ctx := initArgs.NewContext(proc.Kernel)
 	mounter := fs.FileOwnerFromContext(ctx)
 
+	var tty *host.TTYFileOperations
+	if args.TTY {
+		var err error
+		var replica *fs.File
+		if tty, replica, err = host.NewPTY(ctx); err != nil {
+			return nil, nil, fmt.Errorf("allocating pty: %v", err)
+		}
+		defer replica.DecRef()
+		for _, appFD := range []kdefs.FD{0, 1, 2} {
+			if err := fdm.NewFDAt(appFD, replica, kernel.FDFlags{}, l); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
 	for appFD, f := range args.FilePayload.Files {
 		// Copy the underlying FD.
 		newFD, err := syscall.Dup(int(f.Fd()))
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 		f.Close()
 
@@ -118,30 +341,31 @@ func (proc *Proc) Exec(args *ExecArgs, waitStatus *uint32) error {
 		file, err := host.NewFile(ctx, newFD, mounter)
 		if err != nil {
 			syscall.Close(newFD)
-			return err
+			return nil, nil, err
 		}
 		defer file.DecRef()
 		if err := fdm.NewFDAt(kdefs.FD(appFD), file, kernel.FDFlags{}, l); err != nil {
-			return err
+			return nil, nil, err
 		}
 	}
 
 	// Start the new task.
 	newTG, err := proc.Kernel.CreateProcess(initArgs)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-
-	// Wait for completion.
-	newTG.WaitExited()
-	*waitStatus = newTG.ExitStatus().Status()
-	return nil
+	return newTG, tty, nil
 }
 
 // PsArgs is the set of arguments to ps.
 type PsArgs struct {
 	// JSON will force calls to Ps to return the result as a JSON payload.
 	JSON bool
+
+	// Columns selects which fields to report and, for the table format,
+	// their order. An entry that isn't in psColumns is ignored. If empty,
+	// defaultPsColumns is used.
+	Columns []string
 }
 
 // Ps provides a process listing for the running kernel.
@@ -150,10 +374,14 @@ func (proc *Proc) Ps(args *PsArgs, out *string) error {
 	if e := Processes(proc.Kernel, &p); e != nil {
 		return e
 	}
+	columns := args.Columns
+	if len(columns) == 0 {
+		columns = defaultPsColumns
+	}
 	if !args.JSON {
-		*out = ProcessListToTable(p)
+		*out = ProcessListToTable(p, columns)
 	} else {
-		s, e := ProcessListToJSON(p)
+		s, e := ProcessListToJSON(p, columns)
 		if e != nil {
 			return e
 		}
@@ -163,7 +391,6 @@ func (proc *Proc) Ps(args *PsArgs, out *string) error {
 }
 
 // Process contains information about a single process in a Sandbox.
-// TODO: Implement TTY field.
 type Process struct {
 	UID auth.KUID       `json:"uid"`
 	PID kernel.ThreadID `json:"pid"`
@@ -177,38 +404,125 @@ type Process struct {
 	Time string `json:"time"`
 	// Executable shortname (e.g. "sh" for /bin/sh)
 	Cmd string `json:"cmd"`
+	// Controlling terminal, e.g. "pts/0", or "?" if the process has none.
+	TTY string `json:"tty"`
+	// Process state: one of "R" (running), "S" (sleeping), "D"
+	// (uninterruptible sleep), "Z" (zombie) or "T" (stopped).
+	State string `json:"state"`
+	// Number of threads in the thread group.
+	Threads int32 `json:"threads"`
+	// Resident set size, in kB.
+	RSS uint64 `json:"rss"`
+	// Virtual memory size, in kB.
+	VSZ uint64 `json:"vsz"`
+	// Scheduling niceness.
+	Nice int32 `json:"nice"`
+	// Effective capability set, rendered in the "hex=ep" style of
+	// /usr/bin/capsh --decode.
+	Caps string `json:"caps"`
 }
 
-// ProcessListToTable prints a table with the following format:
+// psColumn describes how to label and extract a single ps column. value
+// returns a JSON-marshalable representation of the column for Process p;
+// the table formatter renders it with fmt's default verb. jsonKey is the
+// key the column is reported under in JSON output, matching Process's own
+// json tag for that field rather than the "-o" column name, so that
+// marshaling a column is indistinguishable from marshaling the Process
+// struct field it came from.
+type psColumn struct {
+	header  string
+	jsonKey string
+	value   func(p *Process) interface{}
+}
+
+// psColumns is the registry of columns callers may request via
+// PsArgs.Columns, keyed by the name used on the "-o" command line (in the
+// style of "ps -o pid,tty,state,caps,pcpu,cmd").
+var psColumns = map[string]psColumn{
+	"uid":   {"UID", "uid", func(p *Process) interface{} { return p.UID }},
+	"pid":   {"PID", "pid", func(p *Process) interface{} { return p.PID }},
+	"ppid":  {"PPID", "ppid", func(p *Process) interface{} { return p.PPID }},
+	"pcpu":  {"C", "c", func(p *Process) interface{} { return p.C }},
+	"stime": {"STIME", "stime", func(p *Process) interface{} { return p.STime }},
+	"time":  {"TIME", "time", func(p *Process) interface{} { return p.Time }},
+	"tty":   {"TTY", "tty", func(p *Process) interface{} { return p.TTY }},
+	"state": {"STATE", "state", func(p *Process) interface{} { return p.State }},
+	"nlwp":  {"NLWP", "threads", func(p *Process) interface{} { return p.Threads }},
+	"rss":   {"RSS", "rss", func(p *Process) interface{} { return p.RSS }},
+	"vsz":   {"VSZ", "vsz", func(p *Process) interface{} { return p.VSZ }},
+	"nice":  {"NI", "nice", func(p *Process) interface{} { return p.Nice }},
+	"caps":  {"CAPS", "caps", func(p *Process) interface{} { return p.Caps }},
+	"cmd":   {"CMD", "cmd", func(p *Process) interface{} { return p.Cmd }},
+}
+
+// defaultPsColumns matches the column set ProcessListToTable rendered
+// before PsArgs.Columns existed, so "runsc ps" without "-o" keeps its old
+// output.
+var defaultPsColumns = []string{"uid", "pid", "ppid", "pcpu", "stime", "time", "cmd"}
+
+// ProcessListToTable prints a table containing the requested columns, in
+// the order given. An unknown column name is skipped. With the default
+// columns this reproduces the historical format:
 // UID       PID       PPID      C         STIME     TIME       CMD
 // 0         1         0         0         14:04     505262ns   tail
-func ProcessListToTable(pl []*Process) string {
+func ProcessListToTable(pl []*Process, columns []string) string {
+	cols := resolveColumns(columns)
 	var buf bytes.Buffer
 	tw := tabwriter.NewWriter(&buf, 10, 1, 3, ' ', 0)
-	fmt.Fprint(tw, "UID\tPID\tPPID\tC\tSTIME\tTIME\tCMD")
+	for i, c := range cols {
+		if i > 0 {
+			fmt.Fprint(tw, "\t")
+		}
+		fmt.Fprint(tw, c.header)
+	}
 	for _, d := range pl {
-		fmt.Fprintf(tw, "\n%d\t%d\t%d\t%d\t%s\t%s\t%s",
-			d.UID,
-			d.PID,
-			d.PPID,
-			d.C,
-			d.STime,
-			d.Time,
-			d.Cmd)
+		fmt.Fprint(tw, "\n")
+		for i, c := range cols {
+			if i > 0 {
+				fmt.Fprint(tw, "\t")
+			}
+			fmt.Fprintf(tw, "%v", c.value(d))
+		}
 	}
 	tw.Flush()
 	return buf.String()
 }
 
-// ProcessListToJSON will return the JSON representation of ps.
-func ProcessListToJSON(pl []*Process) (string, error) {
-	b, err := json.Marshal(pl)
+// ProcessListToJSON will return the JSON representation of ps, containing
+// only the requested columns. Rows are keyed by each column's jsonKey, so
+// the default columns reproduce the historical Process JSON field names
+// rather than the "-o" names ("c", not "pcpu"; "threads", not "nlwp").
+// Each row is marshaled as a map, so its keys appear in sorted order, not
+// in Process's field order.
+func ProcessListToJSON(pl []*Process, columns []string) (string, error) {
+	cols := resolveColumns(columns)
+	rows := make([]map[string]interface{}, 0, len(pl))
+	for _, d := range pl {
+		row := make(map[string]interface{}, len(cols))
+		for _, c := range cols {
+			row[c.jsonKey] = c.value(d)
+		}
+		rows = append(rows, row)
+	}
+	b, err := json.Marshal(rows)
 	if err != nil {
-		return "", fmt.Errorf("couldn't marshal process list %v: %v", pl, err)
+		return "", fmt.Errorf("couldn't marshal process list %v: %v", rows, err)
 	}
 	return string(b), nil
 }
 
+// resolveColumns maps column names to their psColumn definitions, dropping
+// any name that isn't registered.
+func resolveColumns(names []string) []psColumn {
+	cols := make([]psColumn, 0, len(names))
+	for _, n := range names {
+		if c, ok := psColumns[n]; ok {
+			cols = append(cols, c)
+		}
+	}
+	return cols
+}
+
 // PrintPIDsJSON prints a JSON object containing only the PIDs in pl. This
 // behavior is the same as runc's.
 func PrintPIDsJSON(pl []*Process) (string, error) {
@@ -234,15 +548,24 @@ func Processes(k *kernel.Kernel, out *[]*Process) error {
 			continue
 		}
 
+		leader := tg.Leader()
+		rss, vsz := memoryUsage(leader)
 		*out = append(*out, &Process{
-			UID: tg.Leader().Credentials().EffectiveKUID,
+			UID: leader.Credentials().EffectiveKUID,
 			PID: pid,
 			// If Parent is null (i.e. tg is the init process), PPID will be 0.
-			PPID:  ts.Root.IDOfTask(tg.Leader().Parent()),
-			STime: formatStartTime(now, tg.Leader().StartTime()),
-			C:     percentCPU(tg.CPUStats(), tg.Leader().StartTime(), now),
-			Time:  tg.CPUStats().SysTime.String(),
-			Cmd:   tg.Leader().Name(),
+			PPID:    ts.Root.IDOfTask(leader.Parent()),
+			STime:   formatStartTime(now, leader.StartTime()),
+			C:       percentCPU(tg.CPUStats(), leader.StartTime(), now),
+			Time:    tg.CPUStats().SysTime.String(),
+			Cmd:     leader.Name(),
+			TTY:     ttyName(leader),
+			State:   stateChar(leader),
+			Threads: int32(tg.Count()),
+			RSS:     rss,
+			VSZ:     vsz,
+			Nice:    leader.Niceness(),
+			Caps:    capsSummary(leader),
 		})
 	}
 	return nil
@@ -267,6 +590,55 @@ func formatStartTime(now, startTime ktime.Time) string {
 	return st.Format(format)
 }
 
+// ttyName returns the name of t's controlling terminal in the style of
+// /proc/[pid]/stat's tty_nr, e.g. "pts/0", or "?" if t has none.
+func ttyName(t *kernel.Task) string {
+	tty := t.TTY()
+	if tty == nil {
+		return "?"
+	}
+	return fmt.Sprintf("pts/%d", tty.Index)
+}
+
+// stateChar renders t's task state as the single-letter code procps and
+// /proc/[pid]/stat use: R(unning), S(leeping), D (uninterruptible sleep),
+// Z(ombie) or T(opped/stopped).
+func stateChar(t *kernel.Task) string {
+	switch t.State() {
+	case kernel.TaskStateRunning:
+		return "R"
+	case kernel.TaskStateBlocked:
+		return "D"
+	case kernel.TaskStateStopped:
+		return "T"
+	case kernel.TaskStateZombie:
+		return "Z"
+	default:
+		return "S"
+	}
+}
+
+// memoryUsage returns t's resident set size and virtual memory size, in
+// kB, matching the units procps reports for RSS/VSZ.
+func memoryUsage(t *kernel.Task) (rss, vsz uint64) {
+	mm := t.MemoryManager()
+	if mm == nil {
+		return 0, 0
+	}
+	return mm.ResidentSetSize() / 1024, mm.VirtualMemorySize() / 1024
+}
+
+// capsSummary renders t's effective capability set the way "getpcaps"
+// does: a hex mask followed by an "=ep" suffix denoting that the listed
+// caps are both effective and permitted.
+func capsSummary(t *kernel.Task) string {
+	eff := uint64(t.Credentials().EffectiveCaps)
+	if eff == 0 {
+		return "="
+	}
+	return fmt.Sprintf("%016x=ep", eff)
+}
+
 func percentCPU(stats usage.CPUStats, startTime, now ktime.Time) int32 {
 	// Note: In procps, there is an option to include child CPU stats. As
 	// it is disabled by default, we do not include them.
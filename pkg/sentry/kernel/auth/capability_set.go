@@ -0,0 +1,40 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+)
+
+// CapabilitySet is a bitmask of Linux capabilities.
+type CapabilitySet uint64
+
+// AllCapabilities is a CapabilitySet containing all capabilities.
+const AllCapabilities = CapabilitySet(^uint64(0))
+
+// CapabilitySetOf returns a CapabilitySet containing only cp.
+func CapabilitySetOf(cp linux.Capability) CapabilitySet {
+	return CapabilitySet(1) << uint(cp)
+}
+
+// CapabilitySetOfMany returns a CapabilitySet containing the given
+// capabilities.
+func CapabilitySetOfMany(cps []linux.Capability) CapabilitySet {
+	var cs CapabilitySet
+	for _, cp := range cps {
+		cs |= CapabilitySetOf(cp)
+	}
+	return cs
+}
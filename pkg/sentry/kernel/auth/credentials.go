@@ -0,0 +1,66 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+// Credentials contains information used for permission checks.
+type Credentials struct {
+	RealKUID      KUID
+	EffectiveKUID KUID
+	SavedKUID     KUID
+
+	RealKGID      KGID
+	EffectiveKGID KGID
+	SavedKGID     KGID
+
+	// ExtraKGIDs is the list of additional groups to which the user
+	// belongs.
+	ExtraKGIDs []KGID
+
+	// TaskCapabilities is the set of capabilities that apply to the
+	// task. See TaskCapabilities.
+	TaskCapabilities
+
+	// UserNamespace is the user namespace in which the task holding
+	// these credentials was created.
+	UserNamespace *UserNamespace
+}
+
+// NewUserCredentials returns a new Credentials for a userspace process
+// with the given KUID, KGID, extra KGIDs and capabilities in ns. If caps
+// is nil, the new Credentials have no capabilities.
+//
+// An ambient capability in caps is folded into both the permitted and
+// effective sets: that is what lets a non-root KUID keep the
+// capabilities an OCI spec's ambient set granted it instead of losing
+// them the moment its effective UID stops being 0, per capabilities(7)'s
+// description of the ambient set's interaction with execve(2).
+func NewUserCredentials(kuid KUID, kgid KGID, extraKGIDs []KGID, caps *TaskCapabilities, ns *UserNamespace) *Credentials {
+	creds := &Credentials{
+		RealKUID:      kuid,
+		EffectiveKUID: kuid,
+		SavedKUID:     kuid,
+		RealKGID:      kgid,
+		EffectiveKGID: kgid,
+		SavedKGID:     kgid,
+		ExtraKGIDs:    extraKGIDs,
+		UserNamespace: ns,
+	}
+	if caps != nil {
+		creds.TaskCapabilities = *caps
+		creds.EffectiveCaps |= caps.AmbientCaps
+		creds.PermittedCaps |= caps.AmbientCaps
+	}
+	return creds
+}
@@ -0,0 +1,63 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+)
+
+func TestNewUserCredentialsAppliesAmbientCaps(t *testing.T) {
+	net := CapabilitySetOf(linux.CAP_NET_BIND_SERVICE)
+	caps := &TaskCapabilities{
+		PermittedCaps:   net,
+		InheritableCaps: net,
+		AmbientCaps:     net,
+	}
+	creds := NewUserCredentials(1000, 1000, nil, caps, nil)
+
+	if got := creds.EffectiveCaps & net; got != net {
+		t.Errorf("ambient capability not granted to effective set: got %#x, want %#x", got, net)
+	}
+	if got := creds.PermittedCaps & net; got != net {
+		t.Errorf("ambient capability not granted to permitted set: got %#x, want %#x", got, net)
+	}
+}
+
+func TestNewUserCredentialsNilCapabilities(t *testing.T) {
+	creds := NewUserCredentials(0, 0, nil, nil, nil)
+	if creds.EffectiveCaps != 0 || creds.PermittedCaps != 0 {
+		t.Errorf("expected no capabilities, got effective=%#x permitted=%#x", creds.EffectiveCaps, creds.PermittedCaps)
+	}
+}
+
+func TestDropBoundingAndInheritableClearsAmbient(t *testing.T) {
+	net := CapabilitySetOf(linux.CAP_NET_BIND_SERVICE)
+	caps := TaskCapabilities{
+		PermittedCaps:   net,
+		InheritableCaps: net,
+		BoundingCaps:    net,
+		AmbientCaps:     net,
+	}
+	caps.DropBoundingAndInheritable(net)
+
+	if caps.AmbientCaps != 0 {
+		t.Errorf("expected ambient capability to be cleared once inheritable was dropped, got %#x", caps.AmbientCaps)
+	}
+	if caps.BoundingCaps != 0 {
+		t.Errorf("expected bounding capability to be dropped, got %#x", caps.BoundingCaps)
+	}
+}
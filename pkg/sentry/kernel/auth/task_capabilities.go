@@ -0,0 +1,51 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+// TaskCapabilities represents all the capability sets for a task. Each of
+// these sets is explained in greater detail in capabilities(7).
+type TaskCapabilities struct {
+	// PermittedCaps is a limiting superset for the effective capabilities.
+	PermittedCaps CapabilitySet
+	// InheritableCaps is preserved across an execve(2).
+	InheritableCaps CapabilitySet
+	// EffectiveCaps is the set used by the kernel to perform permission
+	// checks for the task.
+	EffectiveCaps CapabilitySet
+	// BoundingCaps is a limiting superset for the capabilities that a
+	// task can add to its inheritable set with capset(2).
+	BoundingCaps CapabilitySet
+	// AmbientCaps is preserved across an execve(2) of a program that
+	// does not set the set-user/group-ID bits. It is added to the
+	// permitted and effective sets of a task that execve's such a
+	// program, so the program keeps the capabilities it was granted even
+	// though it runs with a non-root KUID.
+	//
+	// The kernel maintains the invariant AmbientCaps ⊆ PermittedCaps ∩
+	// InheritableCaps: any ambient capability is automatically cleared
+	// when it is dropped from either the permitted or the inheritable
+	// set.
+	AmbientCaps CapabilitySet
+}
+
+// DropBoundingAndInheritable drops cs from both cp.BoundingCaps and
+// cp.InheritableCaps, and clears any now-illegal bit of cp.AmbientCaps as
+// required by the AmbientCaps ⊆ PermittedCaps ∩ InheritableCaps
+// invariant.
+func (cp *TaskCapabilities) DropBoundingAndInheritable(cs CapabilitySet) {
+	cp.BoundingCaps &^= cs
+	cp.InheritableCaps &^= cs
+	cp.AmbientCaps &= cp.PermittedCaps & cp.InheritableCaps
+}
@@ -0,0 +1,86 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sandbox drives a single container's sandbox process through
+// its OCI lifecycle (create, start, destroy).
+package sandbox
+
+import (
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"gvisor.googlesource.com/gvisor/runsc/specutils"
+	"gvisor.googlesource.com/gvisor/runsc/specutils/hooks"
+)
+
+// Sandbox represents a single OCI container's sandbox process.
+//
+// TODO: Forking the sentry/gofer processes, pivoting into the
+// container's rootfs and tearing the sandbox down are not yet
+// implemented here; Create, Start and Destroy below only run the hooks
+// the OCI runtime spec requires around those steps.
+type Sandbox struct {
+	// ID is the container ID.
+	ID string
+
+	// Spec is the container's loaded and validated OCI runtime spec.
+	Spec *specs.Spec
+
+	// BundleDir is the absolute path to the container's bundle
+	// directory, reported to hooks as part of the state document.
+	BundleDir string
+}
+
+// state builds the state document hooks receive on stdin, per the OCI
+// runtime spec's "State" schema.
+func (s *Sandbox) state(status string) *specs.State {
+	return &specs.State{
+		Version: s.Spec.Version,
+		ID:      s.ID,
+		Status:  status,
+		Bundle:  s.BundleDir,
+	}
+}
+
+// Create runs the bundle's Prestart, CreateRuntime and CreateContainer
+// hooks, in that order, as required before the sandbox pivots into the
+// container's root filesystem. Prestart in particular must run in the
+// runtime's own namespaces so hooks like CNI plugins can still see and
+// modify host-side network state.
+func (s *Sandbox) Create() error {
+	state := s.state("creating")
+	for _, phase := range []hooks.HookPhase{hooks.Prestart, hooks.CreateRuntime, hooks.CreateContainer} {
+		if err := specutils.RunLifecycleHooks(s.Spec, state, phase); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start runs the bundle's StartContainer hook immediately before the
+// container's entrypoint starts, then its Poststart hook once it has.
+func (s *Sandbox) Start() error {
+	state := s.state("running")
+	if err := specutils.RunLifecycleHooks(s.Spec, state, hooks.StartContainer); err != nil {
+		return err
+	}
+	return specutils.RunLifecycleHooks(s.Spec, state, hooks.Poststart)
+}
+
+// Destroy runs the bundle's Poststop hook once the sandbox has been torn
+// down. specutils.RunLifecycleHooks already logs rather than propagates
+// a Poststop failure, since there is no container left to roll back by
+// the time it runs.
+func (s *Sandbox) Destroy() error {
+	return specutils.RunLifecycleHooks(s.Spec, s.state("stopped"), hooks.Poststop)
+}
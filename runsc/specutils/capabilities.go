@@ -0,0 +1,177 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package specutils
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
+)
+
+// maxKnownCap is the highest capability number capFromName (plus the
+// kernel-gated additions in init) knows the name of. It bounds the loops
+// below to the capability numbers runsc can name; the running kernel may
+// still not know the highest of them.
+const maxKnownCap = linux.Capability(40) // CAP_CHECKPOINT_RESTORE
+
+// capUserHeader mirrors struct __user_cap_header_struct from
+// linux/capability.h.
+type capUserHeader struct {
+	version uint32
+	pid     int32
+}
+
+// capUserData mirrors struct __user_cap_data_struct from
+// linux/capability.h. The kernel's capget(2) fills in one of these per 32
+// capability bits, so a version-3 header yields a [2]capUserData covering
+// 64 capability bits.
+type capUserData struct {
+	effective   uint32
+	permitted   uint32
+	inheritable uint32
+}
+
+// linuxCapVersion3 is _LINUX_CAPABILITY_VERSION_3, the only capget/capset
+// ABI version that supports more than 32 capabilities.
+const linuxCapVersion3 = 0x20080522
+
+// SelfCaps returns the effective, permitted and bounding capability sets
+// of the calling thread, read directly via capget(2) and
+// prctl(PR_CAPBSET_READ) rather than parsing /proc/self/status.
+func SelfCaps() (effective, permitted, bounding auth.CapabilitySet, err error) {
+	hdr := capUserHeader{version: linuxCapVersion3}
+	var data [2]capUserData
+	if _, _, errno := syscall.Syscall(syscall.SYS_CAPGET, uintptr(unsafe.Pointer(&hdr)), uintptr(unsafe.Pointer(&data[0])), 0); errno != 0 {
+		return 0, 0, 0, fmt.Errorf("capget: %v", errno)
+	}
+	effective = auth.CapabilitySet(uint64(data[0].effective) | uint64(data[1].effective)<<32)
+	permitted = auth.CapabilitySet(uint64(data[0].permitted) | uint64(data[1].permitted)<<32)
+
+	// The bounding set isn't reported by capget; each bit has to be
+	// queried individually. PR_CAPBSET_READ returns EINVAL for any
+	// capability number the running kernel doesn't know about (e.g. the
+	// post-3.5 capabilities registered in specutils.go's init on a
+	// kernel too old to have them), which isn't a failure: it just means
+	// there's nothing higher left to probe.
+	for c := linux.Capability(0); c <= maxKnownCap; c++ {
+		r, _, errno := syscall.Syscall(syscall.SYS_PRCTL, uintptr(syscall.PR_CAPBSET_READ), uintptr(c), 0)
+		if errno == syscall.EINVAL {
+			break
+		}
+		if errno != 0 {
+			return 0, 0, 0, fmt.Errorf("prctl(PR_CAPBSET_READ, %d): %v", c, errno)
+		}
+		if r != 0 {
+			bounding |= auth.CapabilitySetOf(c)
+		}
+	}
+	return effective, permitted, bounding, nil
+}
+
+// HasCap reports whether the calling thread currently holds c in its
+// permitted set. Callers should use this to gracefully skip an operation
+// runsc doesn't strictly need (e.g. a mount namespace tweak) rather than
+// hard-failing when runsc was launched with a narrower capability set
+// than usual.
+func HasCap(c linux.Capability) bool {
+	_, permitted, _, err := SelfCaps()
+	if err != nil {
+		return false
+	}
+	return permitted&auth.CapabilitySetOf(c) != 0
+}
+
+// platformCaps lists the extra capabilities each platform requires beyond
+// capsCommon.
+var platformCaps = map[string][]linux.Capability{
+	"ptrace": {linux.CAP_SYS_PTRACE},
+	"kvm":    {},
+}
+
+// capsCommon lists the capabilities every runsc invocation needs,
+// regardless of platform or network mode: CAP_SYS_ADMIN for creating the
+// mount and other namespaces the sandbox and gofer processes live in.
+var capsCommon = []linux.Capability{linux.CAP_SYS_ADMIN}
+
+// DropToMinimum drops every capability runsc doesn't need for the given
+// platform and network mode from the bounding and inheritable sets,
+// before runsc execve's the sandbox helper. This follows the principle
+// of least privilege: a compromised sentry or gofer process running
+// under a dropped bounding set can't regain capabilities it never had,
+// and one that can't inherit them can't hand them to a child either.
+func DropToMinimum(platform string, netMode string) error {
+	required := make(map[linux.Capability]bool)
+	for _, c := range capsCommon {
+		required[c] = true
+	}
+	for _, c := range platformCaps[platform] {
+		required[c] = true
+	}
+	if netMode == "sandbox" {
+		// The netstack network mode implements the network stack in the
+		// sentry itself and needs to configure interfaces.
+		required[linux.CAP_NET_ADMIN] = true
+	}
+
+	_, _, bounding, err := SelfCaps()
+	if err != nil {
+		return fmt.Errorf("reading self capabilities: %v", err)
+	}
+	var toDrop auth.CapabilitySet
+	for c := linux.Capability(0); c <= maxKnownCap; c++ {
+		if required[c] {
+			continue
+		}
+		toDrop |= auth.CapabilitySetOf(c)
+		if bounding&auth.CapabilitySetOf(c) == 0 {
+			// Already outside the bounding set; PR_CAPBSET_DROP would
+			// just fail.
+			continue
+		}
+		if _, _, errno := syscall.Syscall(syscall.SYS_PRCTL, uintptr(syscall.PR_CAPBSET_DROP), uintptr(c), 0); errno != 0 {
+			return fmt.Errorf("dropping capability %d from bounding set: %v", c, errno)
+		}
+	}
+	if err := dropInheritable(toDrop); err != nil {
+		return fmt.Errorf("dropping inheritable capabilities: %v", err)
+	}
+	return nil
+}
+
+// dropInheritable clears every capability in drop from the calling
+// thread's inheritable set via capset(2), leaving the effective and
+// permitted sets untouched. Unlike the bounding set, there's no
+// per-capability prctl for this: capset(2) always sets all three sets at
+// once, so the current effective and permitted bits have to be read back
+// and passed through unchanged.
+func dropInheritable(drop auth.CapabilitySet) error {
+	hdr := capUserHeader{version: linuxCapVersion3}
+	var cur [2]capUserData
+	if _, _, errno := syscall.Syscall(syscall.SYS_CAPGET, uintptr(unsafe.Pointer(&hdr)), uintptr(unsafe.Pointer(&cur[0])), 0); errno != 0 {
+		return fmt.Errorf("capget: %v", errno)
+	}
+	inheritable := auth.CapabilitySet(uint64(cur[0].inheritable)|uint64(cur[1].inheritable)<<32) &^ drop
+
+	next := cur
+	next[0].inheritable = uint32(inheritable)
+	next[1].inheritable = uint32(inheritable >> 32)
+	if _, _, errno := syscall.Syscall(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&hdr)), uintptr(unsafe.Pointer(&next[0])), 0); errno != 0 {
+		return fmt.Errorf("capset: %v", errno)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hooks runs the OCI runtime spec's lifecycle hooks (Prestart,
+// CreateRuntime, CreateContainer, StartContainer, Poststart and
+// Poststop), as required by the OCI runtime spec's "Lifecycle" section.
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// HookPhase identifies a point in the container lifecycle at which a set
+// of OCI hooks is run.
+type HookPhase int
+
+// The hook phases defined by the OCI runtime spec, in the order the
+// runtime is required to run them in.
+const (
+	Prestart HookPhase = iota
+	CreateRuntime
+	CreateContainer
+	StartContainer
+	Poststart
+	Poststop
+)
+
+// String implements fmt.Stringer, matching the name of the Hooks field
+// the phase is drawn from (e.g. "poststart" for spec.Hooks.Poststart).
+func (p HookPhase) String() string {
+	switch p {
+	case Prestart:
+		return "prestart"
+	case CreateRuntime:
+		return "createRuntime"
+	case CreateContainer:
+		return "createContainer"
+	case StartContainer:
+		return "startContainer"
+	case Poststart:
+		return "poststart"
+	case Poststop:
+		return "poststop"
+	default:
+		return fmt.Sprintf("HookPhase(%d)", int(p))
+	}
+}
+
+// hooksForPhase picks the []specs.Hook slice spec.Hooks stores for phase.
+func hooksForPhase(spec *specs.Hooks, phase HookPhase) []specs.Hook {
+	if spec == nil {
+		return nil
+	}
+	switch phase {
+	case Prestart:
+		return spec.Prestart
+	case CreateRuntime:
+		return spec.CreateRuntime
+	case CreateContainer:
+		return spec.CreateContainer
+	case StartContainer:
+		return spec.StartContainer
+	case Poststart:
+		return spec.Poststart
+	case Poststop:
+		return spec.Poststop
+	default:
+		return nil
+	}
+}
+
+// Run looks up and runs every hook registered for phase, in order,
+// passing state to each on stdin as required by the OCI runtime spec. It
+// is a convenience wrapper around RunHooks for callers that already have
+// the full specs.Hooks struct rather than a single phase's slice.
+func Run(allHooks *specs.Hooks, state *specs.State, phase HookPhase) error {
+	return RunHooks(hooksForPhase(allHooks, phase), state, phase)
+}
+
+// RunHooks runs each hook in hooks in order, passing state to each as a
+// JSON document on stdin. A hook that doesn't exit within its configured
+// Timeout is killed with SIGKILL. Every hook runs even if an earlier one
+// fails or times out; the errors are aggregated so the caller sees the
+// full picture instead of only the first failure.
+func RunHooks(hooks []specs.Hook, state *specs.State, phase HookPhase) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+	stateJSON, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("marshaling state for %s hooks: %v", phase, err)
+	}
+
+	var errs []error
+	for i, h := range hooks {
+		if err := runHook(h, stateJSON); err != nil {
+			errs = append(errs, fmt.Errorf("%s hook %d (%s): %v", phase, i, h.Path, err))
+		}
+	}
+	if len(errs) > 0 {
+		return &HookError{Phase: phase, Errs: errs}
+	}
+	return nil
+}
+
+// HookError aggregates the failures from every hook run for a single
+// phase, since OCI requires running all of them rather than stopping at
+// the first failure.
+type HookError struct {
+	Phase HookPhase
+	Errs  []error
+}
+
+// Error implements error.
+func (e *HookError) Error() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d %s hook(s) failed:", len(e.Errs), e.Phase)
+	for _, err := range e.Errs {
+		fmt.Fprintf(&buf, "\n  %v", err)
+	}
+	return buf.String()
+}
+
+// runHook runs a single hook, writing stateJSON to its stdin and
+// enforcing h.Timeout if set.
+func runHook(h specs.Hook, stateJSON []byte) error {
+	// h.Args is the hook's full argv, including argv[0], as the OCI spec
+	// defines it; exec.Command(h.Path, h.Args...) would instead prepend
+	// h.Path as an extra argv[0], shifting every argument the hook sees.
+	// Build the Cmd directly so h.Args lands in argv unmodified, falling
+	// back to just the path if the spec didn't set Args.
+	args := h.Args
+	if len(args) == 0 {
+		args = []string{h.Path}
+	}
+	cmd := &exec.Cmd{Path: h.Path, Args: args}
+	cmd.Env = h.Env
+	cmd.Stdin = bytes.NewReader(stateJSON)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting hook: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	var timeout <-chan time.Time
+	if h.Timeout != nil {
+		t := time.NewTimer(time.Duration(*h.Timeout) * time.Second)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("hook failed: %v, stdout: %q, stderr: %q", err, stdout.String(), stderr.String())
+		}
+		return nil
+	case <-timeout:
+		cmd.Process.Kill()
+		<-done
+		return fmt.Errorf("hook timed out after %ds", *h.Timeout)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hooks
+
+import (
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// TestRunHookArgsNotShifted verifies that a hook's Args, which per the OCI
+// spec already include argv[0], reach the hook unshifted: if runHook
+// prepended h.Path as an extra argument, this script's "$#"/"$1" checks
+// would fail and the hook would exit non-zero.
+func TestRunHookArgsNotShifted(t *testing.T) {
+	h := specs.Hook{
+		Path: "/bin/sh",
+		Args: []string{"sh", "-c", `[ "$#" -eq 1 ] && [ "$1" = "only-arg" ]`, "sh", "only-arg"},
+	}
+	if err := RunHooks([]specs.Hook{h}, &specs.State{}, Prestart); err != nil {
+		t.Errorf("hook with well-formed argv failed: %v", err)
+	}
+}
+
+// TestRunHookDefaultArgs verifies that a hook with no Args set still runs,
+// using Path as argv[0].
+func TestRunHookDefaultArgs(t *testing.T) {
+	h := specs.Hook{Path: "/bin/true"}
+	if err := RunHooks([]specs.Hook{h}, &specs.State{}, Prestart); err != nil {
+		t.Errorf("hook with empty Args failed: %v", err)
+	}
+}
+
+func TestRunHooksAggregatesFailures(t *testing.T) {
+	hs := []specs.Hook{
+		{Path: "/bin/false"},
+		{Path: "/bin/false"},
+	}
+	err := RunHooks(hs, &specs.State{}, Poststart)
+	if err == nil {
+		t.Fatal("expected an error from two failing hooks")
+	}
+	herr, ok := err.(*HookError)
+	if !ok {
+		t.Fatalf("expected a *HookError, got %T: %v", err, err)
+	}
+	if len(herr.Errs) != 2 {
+		t.Errorf("expected 2 aggregated errors, got %d: %v", len(herr.Errs), herr.Errs)
+	}
+}
@@ -30,6 +30,7 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/log"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.googlesource.com/gvisor/runsc/specutils/hooks"
 )
 
 // LogSpec logs the spec in a human-friendly way.
@@ -41,10 +42,26 @@ func LogSpec(spec *specs.Spec) {
 	log.Debugf("Spec.Root: %+v", spec.Root)
 }
 
-// ReadSpec reads an OCI runtime spec from the given bundle directory.
-//
-// TODO: This should validate the spec.
-func ReadSpec(bundleDir string) (*specs.Spec, error) {
+// RunLifecycleHooks runs the hooks spec registers for phase, if any,
+// logging (rather than failing) a Poststop error since by the time
+// poststop hooks run the container is already gone and there is nothing
+// left to roll back.
+func RunLifecycleHooks(spec *specs.Spec, state *specs.State, phase hooks.HookPhase) error {
+	if err := hooks.Run(spec.Hooks, state, phase); err != nil {
+		if phase == hooks.Poststop {
+			log.Warningf("poststop hooks failed: %v", err)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// ReadSpec reads an OCI runtime spec from the given bundle directory and
+// validates it. In strict mode, any validation error causes ReadSpec to
+// fail; otherwise only errors severe enough to crash the sentry mid-boot
+// are fatal and the rest are logged as warnings.
+func ReadSpec(bundleDir string, strict bool) (*specs.Spec, error) {
 	// The spec file must be in "config.json" inside the bundle directory.
 	specFile := filepath.Join(bundleDir, "config.json")
 	specBytes, err := ioutil.ReadFile(specFile)
@@ -55,6 +72,17 @@ func ReadSpec(bundleDir string) (*specs.Spec, error) {
 	if err := json.Unmarshal(specBytes, &spec); err != nil {
 		return nil, fmt.Errorf("error unmarshaling spec from file %q: %v\n %s", specFile, err, string(specBytes))
 	}
+	errs := ValidateSpec(&spec, ValidateOptions{Strict: true})
+	fatal := errs
+	if !strict {
+		fatal = filterNonFatal(errs)
+	}
+	if len(fatal) > 0 {
+		return nil, fmt.Errorf("invalid spec from file %q: %v", specFile, fatal)
+	}
+	for _, e := range errs {
+		log.Warningf("spec from file %q has a validation issue: %v", specFile, e)
+	}
 	return &spec, nil
 }
 
@@ -112,7 +140,15 @@ func Capabilities(specCaps *specs.LinuxCapabilities) (*auth.TaskCapabilities, er
 		if caps.PermittedCaps, err = capsFromNames(specCaps.Permitted); err != nil {
 			return nil, err
 		}
-		// TODO: Support ambient capabilities.
+		if caps.AmbientCaps, err = capsFromNames(specCaps.Ambient); err != nil {
+			return nil, err
+		}
+		// The kernel only ever allows an ambient capability that is both
+		// permitted and inheritable; reject a spec that claims otherwise up
+		// front instead of letting the sentry silently narrow it down.
+		if illegal := caps.AmbientCaps &^ (caps.PermittedCaps & caps.InheritableCaps); illegal != 0 {
+			return nil, fmt.Errorf("ambient capabilities %#x are not a subset of the permitted and inheritable sets", illegal)
+		}
 	}
 	return &caps, nil
 }
@@ -158,6 +194,45 @@ var capFromName = map[string]linux.Capability{
 	"CAP_AUDIT_READ":       linux.CAP_AUDIT_READ,
 }
 
+// Capabilities added to Linux after CAP_AUDIT_READ. They're only meaningful
+// to an OCI spec generated on a host new enough to know about them, so they
+// are registered in capFromName by init, gated on the running
+// kernel's version, rather than unconditionally: that way a spec built with
+// an up-to-date runc on a newer host doesn't fail with "unknown capability"
+// here, while an older kernel that has no idea what CAP_BPF means still
+// gets a clear error instead of silently accepting a no-op capability.
+const (
+	capPerfmon           = linux.Capability(38)
+	capBPF               = linux.Capability(39)
+	capCheckpointRestore = linux.Capability(40)
+)
+
+func init() {
+	if kernelAtLeast(5, 8) {
+		capFromName["CAP_PERFMON"] = capPerfmon
+		capFromName["CAP_BPF"] = capBPF
+	}
+	if kernelAtLeast(5, 9) {
+		capFromName["CAP_CHECKPOINT_RESTORE"] = capCheckpointRestore
+	}
+}
+
+// kernelAtLeast reports whether the running host kernel's version is at
+// least major.minor. It returns false if uname can't be read or parsed,
+// leaving the optional behavior it gates disabled.
+func kernelAtLeast(major, minor int) bool {
+	var uts syscall.Utsname
+	if err := syscall.Uname(&uts); err != nil {
+		return false
+	}
+	release := utsnameRelease(&uts)
+	var gotMajor, gotMinor int
+	if n, err := fmt.Sscanf(release, "%d.%d", &gotMajor, &gotMinor); err != nil || n != 2 {
+		return false
+	}
+	return gotMajor > major || (gotMajor == major && gotMinor >= minor)
+}
+
 func capsFromNames(names []string) (auth.CapabilitySet, error) {
 	var caps []linux.Capability
 	for _, n := range names {
@@ -0,0 +1,32 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package specutils
+
+import "syscall"
+
+// utsnameRelease extracts the NUL-terminated release string out of
+// uts.Release, whose element type is int8 on amd64 but uint8 on arm64;
+// each arch file does its own narrowing so kernelAtLeast doesn't have to
+// know which one it's running on.
+func utsnameRelease(uts *syscall.Utsname) string {
+	b := make([]byte, 0, len(uts.Release))
+	for _, v := range uts.Release {
+		if v == 0 {
+			break
+		}
+		b = append(b, byte(v))
+	}
+	return string(b)
+}
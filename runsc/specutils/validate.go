@@ -0,0 +1,319 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package specutils
+
+import (
+	"fmt"
+	"path/filepath"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// ValidationErrorCode identifies the class of a spec validation failure so
+// that callers can handle specific failures programmatically (e.g. retry
+// with a relaxed mount list) without parsing error strings.
+type ValidationErrorCode string
+
+// The set of validation error codes produced by ValidateSpec.
+const (
+	ErrMissingField      ValidationErrorCode = "missing_field"
+	ErrInvalidField      ValidationErrorCode = "invalid_field"
+	ErrDuplicateMount    ValidationErrorCode = "duplicate_mount"
+	ErrInvalidNamespace  ValidationErrorCode = "invalid_namespace"
+	ErrInvalidResource   ValidationErrorCode = "invalid_resource"
+	ErrInvalidSeccomp    ValidationErrorCode = "invalid_seccomp"
+	ErrInvalidCapability ValidationErrorCode = "invalid_capability"
+)
+
+// ValidationError is a single spec validation failure. Field is a
+// dotted-path pointing at the offending part of the spec (e.g.
+// "linux.namespaces[2].path"), in the style of the OCI runtime-tools
+// validator.
+type ValidationError struct {
+	Field string
+	Code  ValidationErrorCode
+	Err   error
+}
+
+// Error implements error.
+func (v *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %v", v.Field, v.Err)
+}
+
+func newValidationError(field string, code ValidationErrorCode, format string, a ...interface{}) *ValidationError {
+	return &ValidationError{Field: field, Code: code, Err: fmt.Errorf(format, a...)}
+}
+
+// ValidateOptions controls how strictly ValidateSpec checks a spec.
+type ValidateOptions struct {
+	// Strict causes ValidateSpec to reject specs with any validation
+	// error. When false, only errors that would cause the sentry to
+	// fail in a confusing way during boot are reported; cosmetic
+	// mistakes are ignored.
+	Strict bool
+}
+
+// ValidateSpec validates spec against the subset of the OCI runtime spec
+// that runsc relies on, in the spirit of the opencontainers/runtime-tools
+// validator. It never mutates spec and returns one error per problem found,
+// so that callers can report everything wrong with a bundle in one pass
+// instead of fixing errors one at a time.
+func ValidateSpec(spec *specs.Spec, opts ValidateOptions) []error {
+	var errs []error
+	errs = append(errs, validateRoot(spec)...)
+	errs = append(errs, validateProcess(spec)...)
+	errs = append(errs, validateMounts(spec)...)
+	if spec.Linux != nil {
+		errs = append(errs, validateNamespaces(spec.Linux)...)
+		errs = append(errs, validateResources(spec.Linux)...)
+		errs = append(errs, validateSeccomp(spec.Linux)...)
+	}
+	errs = append(errs, validateCapabilities(spec)...)
+
+	if !opts.Strict {
+		errs = filterNonFatal(errs)
+	}
+	return errs
+}
+
+// filterNonFatal drops validation errors that runsc can tolerate outside of
+// strict mode: anything that isn't going to surface as an obscure sentry
+// panic or an unbootable sandbox is left for the user to fix at their
+// leisure.
+func filterNonFatal(errs []error) []error {
+	var out []error
+	for _, e := range errs {
+		if ve, ok := e.(*ValidationError); ok {
+			switch ve.Code {
+			case ErrInvalidResource:
+				continue
+			}
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+func validateRoot(spec *specs.Spec) []error {
+	var errs []error
+	if spec.Version == "" {
+		errs = append(errs, newValidationError("ociVersion", ErrMissingField, "ociVersion is required"))
+	}
+	if spec.Root == nil {
+		errs = append(errs, newValidationError("root", ErrMissingField, "root is required"))
+		return errs
+	}
+	if spec.Root.Path == "" {
+		errs = append(errs, newValidationError("root.path", ErrMissingField, "root.path is required"))
+	}
+	return errs
+}
+
+func validateProcess(spec *specs.Spec) []error {
+	var errs []error
+	if spec.Process == nil {
+		errs = append(errs, newValidationError("process", ErrMissingField, "process is required"))
+		return errs
+	}
+	if len(spec.Process.Args) == 0 {
+		errs = append(errs, newValidationError("process.args", ErrMissingField, "process.args must contain at least one entry"))
+	}
+	return errs
+}
+
+// validateMounts checks the constraints runsc needs to safely set up the
+// container's mount namespace: every destination must be an absolute path,
+// no two mounts may target the same destination (the last one to apply
+// would silently shadow the rest, which is never what the bundle author
+// intended), no mount's options may contradict themselves, and nothing
+// reopens a root filesystem the spec declared read-only.
+func validateMounts(spec *specs.Spec) []error {
+	var errs []error
+	seen := make(map[string]bool)
+	for i, m := range spec.Mounts {
+		field := fmt.Sprintf("mounts[%d]", i)
+		if !filepath.IsAbs(m.Destination) {
+			errs = append(errs, newValidationError(field+".destination", ErrInvalidField, "destination %q must be an absolute path", m.Destination))
+		}
+		if seen[m.Destination] {
+			errs = append(errs, newValidationError(field+".destination", ErrDuplicateMount, "duplicate mount destination %q", m.Destination))
+		}
+		seen[m.Destination] = true
+
+		var hasRO, hasRW bool
+		for _, o := range m.Options {
+			switch o {
+			case "ro":
+				hasRO = true
+			case "rw":
+				hasRW = true
+			}
+		}
+		if hasRO && hasRW {
+			errs = append(errs, newValidationError(field+".options", ErrInvalidField, "mount %q specifies both %q and %q", m.Destination, "ro", "rw"))
+		}
+		if spec.Root != nil && spec.Root.Readonly && m.Destination == "/" && hasRW {
+			errs = append(errs, newValidationError(field+".options", ErrInvalidField, "mount remounts root %q read-write, but root.readonly is set", m.Destination))
+		}
+	}
+
+	if spec.Linux != nil && spec.Linux.RootfsPropagation != "" {
+		switch spec.Linux.RootfsPropagation {
+		case "shared", "slave", "private", "unbindable":
+		default:
+			errs = append(errs, newValidationError("linux.rootfsPropagation", ErrInvalidField, "unknown rootfs propagation mode %q", spec.Linux.RootfsPropagation))
+		}
+	}
+	return errs
+}
+
+// validateNamespaces enforces the pairing rules the OCI spec documents for
+// Linux namespaces: a user namespace requires uid/gid mappings, and
+// uid/gid mappings require a user namespace. It also rejects a namespace
+// type listed more than once and a namespace path that isn't absolute.
+// Network, UTS and IPC namespaces get no checks beyond these.
+func validateNamespaces(l *specs.Linux) []error {
+	var errs []error
+	var hasUserNS bool
+	kinds := make(map[specs.LinuxNamespaceType]bool)
+	for i, ns := range l.Namespaces {
+		field := fmt.Sprintf("linux.namespaces[%d]", i)
+		if kinds[ns.Type] {
+			errs = append(errs, newValidationError(field+".type", ErrInvalidNamespace, "duplicate namespace of type %q", ns.Type))
+		}
+		kinds[ns.Type] = true
+		if ns.Type == specs.UserNamespace {
+			hasUserNS = true
+		}
+		if ns.Path != "" && !filepath.IsAbs(ns.Path) {
+			errs = append(errs, newValidationError(field+".path", ErrInvalidNamespace, "namespace path %q must be absolute", ns.Path))
+		}
+	}
+
+	if hasUserNS {
+		if len(l.UIDMappings) == 0 {
+			errs = append(errs, newValidationError("linux.uidMappings", ErrInvalidNamespace, "a user namespace requires at least one uid mapping"))
+		}
+		if len(l.GIDMappings) == 0 {
+			errs = append(errs, newValidationError("linux.gidMappings", ErrInvalidNamespace, "a user namespace requires at least one gid mapping"))
+		}
+	} else {
+		if len(l.UIDMappings) > 0 || len(l.GIDMappings) > 0 {
+			errs = append(errs, newValidationError("linux.namespaces", ErrInvalidNamespace, "uid/gid mappings require a user namespace"))
+		}
+	}
+	return errs
+}
+
+// validateResources sanity-checks the handful of resource limits the
+// sentry interprets, rejecting ranges that can never be satisfied (e.g. a
+// zero CPU share) rather than letting them fail deep inside the
+// scheduler.
+func validateResources(l *specs.Linux) []error {
+	var errs []error
+	if l.Resources == nil {
+		return errs
+	}
+	if cpu := l.Resources.CPU; cpu != nil {
+		if cpu.Shares != nil && *cpu.Shares == 0 {
+			errs = append(errs, newValidationError("linux.resources.cpu.shares", ErrInvalidResource, "cpu shares must be non-zero if set"))
+		}
+		if cpu.Period != nil && *cpu.Period == 0 {
+			errs = append(errs, newValidationError("linux.resources.cpu.period", ErrInvalidResource, "cpu period must be non-zero if set"))
+		}
+		if cpu.Quota != nil && *cpu.Quota == 0 {
+			errs = append(errs, newValidationError("linux.resources.cpu.quota", ErrInvalidResource, "cpu quota must be non-zero if set"))
+		}
+	}
+	// -1 means "unlimited" in both runc and the cgroup memory controller
+	// itself; any other non-positive value can never be satisfied.
+	if mem := l.Resources.Memory; mem != nil && mem.Limit != nil && *mem.Limit != -1 && *mem.Limit <= 0 {
+		errs = append(errs, newValidationError("linux.resources.memory.limit", ErrInvalidResource, "memory limit must be positive, or -1 for unlimited"))
+	}
+	return errs
+}
+
+var validSeccompActions = map[specs.LinuxSeccompAction]bool{
+	specs.ActKill:  true,
+	specs.ActTrap:  true,
+	specs.ActErrno: true,
+	specs.ActTrace: true,
+	specs.ActAllow: true,
+}
+
+var validSeccompArches = map[specs.Arch]bool{
+	specs.ArchX86:         true,
+	specs.ArchX86_64:      true,
+	specs.ArchX32:         true,
+	specs.ArchARM:         true,
+	specs.ArchAARCH64:     true,
+	specs.ArchMIPS:        true,
+	specs.ArchMIPS64:      true,
+	specs.ArchMIPS64N32:   true,
+	specs.ArchMIPSEL:      true,
+	specs.ArchMIPSEL64:    true,
+	specs.ArchMIPSEL64N32: true,
+	specs.ArchPPC:         true,
+	specs.ArchPPC64:       true,
+	specs.ArchPPC64LE:     true,
+	specs.ArchS390:        true,
+	specs.ArchS390X:       true,
+}
+
+func validateSeccomp(l *specs.Linux) []error {
+	var errs []error
+	if l.Seccomp == nil {
+		return errs
+	}
+	if !validSeccompActions[l.Seccomp.DefaultAction] {
+		errs = append(errs, newValidationError("linux.seccomp.defaultAction", ErrInvalidSeccomp, "unknown default action %q", l.Seccomp.DefaultAction))
+	}
+	for i, arch := range l.Seccomp.Architectures {
+		if !validSeccompArches[arch] {
+			errs = append(errs, newValidationError(fmt.Sprintf("linux.seccomp.architectures[%d]", i), ErrInvalidSeccomp, "unknown architecture %q", arch))
+		}
+	}
+	for i, rule := range l.Seccomp.Syscalls {
+		if !validSeccompActions[rule.Action] {
+			errs = append(errs, newValidationError(fmt.Sprintf("linux.seccomp.syscalls[%d].action", i), ErrInvalidSeccomp, "unknown action %q", rule.Action))
+		}
+	}
+	return errs
+}
+
+// validateCapabilities checks every capability name referenced by the spec
+// against capFromName, the same table Capabilities uses to build the
+// sentry's TaskCapabilities. An unknown name here would otherwise surface
+// much later as an opaque error out of Capabilities.
+func validateCapabilities(spec *specs.Spec) []error {
+	if spec.Process == nil || spec.Process.Capabilities == nil {
+		return nil
+	}
+	var errs []error
+	check := func(field string, names []string) {
+		for _, n := range names {
+			if _, ok := capFromName[n]; !ok {
+				errs = append(errs, newValidationError(field, ErrInvalidCapability, "unknown capability %q", n))
+			}
+		}
+	}
+	c := spec.Process.Capabilities
+	check("process.capabilities.bounding", c.Bounding)
+	check("process.capabilities.effective", c.Effective)
+	check("process.capabilities.inheritable", c.Inheritable)
+	check("process.capabilities.permitted", c.Permitted)
+	check("process.capabilities.ambient", c.Ambient)
+	return errs
+}
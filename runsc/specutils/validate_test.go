@@ -0,0 +1,81 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package specutils
+
+import (
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func validSpec() *specs.Spec {
+	return &specs.Spec{
+		Version: "1.0.0",
+		Root:    &specs.Root{Path: "rootfs"},
+		Process: &specs.Process{Args: []string{"sh"}},
+	}
+}
+
+func TestValidateSpecAllowsUnlimitedMemory(t *testing.T) {
+	spec := validSpec()
+	limit := int64(-1)
+	spec.Linux = &specs.Linux{Resources: &specs.LinuxResources{Memory: &specs.LinuxMemory{Limit: &limit}}}
+	if errs := ValidateSpec(spec, ValidateOptions{Strict: true}); len(errs) != 0 {
+		t.Errorf("expected memory.limit=-1 to be valid (unlimited), got errors: %v", errs)
+	}
+}
+
+func TestValidateSpecRejectsZeroMemoryLimit(t *testing.T) {
+	spec := validSpec()
+	limit := int64(0)
+	spec.Linux = &specs.Linux{Resources: &specs.LinuxResources{Memory: &specs.LinuxMemory{Limit: &limit}}}
+	if errs := ValidateSpec(spec, ValidateOptions{Strict: true}); len(errs) == 0 {
+		t.Error("expected memory.limit=0 to be rejected")
+	}
+}
+
+func TestValidateSpecAllowsRelativeCgroupsPath(t *testing.T) {
+	spec := validSpec()
+	spec.Linux = &specs.Linux{CgroupsPath: "user.slice:runsc:abcd1234"}
+	if errs := ValidateSpec(spec, ValidateOptions{Strict: true}); len(errs) != 0 {
+		t.Errorf("expected a relative cgroupsPath to be accepted, got errors: %v", errs)
+	}
+}
+
+func TestValidateSpecRejectsContradictoryMountOptions(t *testing.T) {
+	spec := validSpec()
+	spec.Mounts = []specs.Mount{{Destination: "/data", Options: []string{"ro", "rw"}}}
+	if errs := ValidateSpec(spec, ValidateOptions{Strict: true}); len(errs) == 0 {
+		t.Error("expected a mount specifying both \"ro\" and \"rw\" to be rejected")
+	}
+}
+
+func TestValidateSpecRejectsReadWriteRootWhenReadonly(t *testing.T) {
+	spec := validSpec()
+	spec.Root.Readonly = true
+	spec.Mounts = []specs.Mount{{Destination: "/", Options: []string{"rw"}}}
+	if errs := ValidateSpec(spec, ValidateOptions{Strict: true}); len(errs) == 0 {
+		t.Error("expected a mount remounting root read-write to be rejected when root.readonly is set")
+	}
+}
+
+func TestValidateSpecAllowsReadonlyRootWithReadonlyMount(t *testing.T) {
+	spec := validSpec()
+	spec.Root.Readonly = true
+	spec.Mounts = []specs.Mount{{Destination: "/", Options: []string{"ro"}}}
+	if errs := ValidateSpec(spec, ValidateOptions{Strict: true}); len(errs) != 0 {
+		t.Errorf("expected a read-only mount to be consistent with root.readonly, got errors: %v", errs)
+	}
+}